@@ -36,62 +36,188 @@ import (
 	"github.com/fatih/color"
 	"github.com/ipfs/go-cid"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
 )
 
 var cr *p2p.ChatRoom
 var discoveredRooms = make(map[string]bool)
 var discoveredRoomsMu sync.Mutex
 
+// peerNicks maps nicknames seen in chat to the peer ID that sent them, so
+// /get-file can target a specific peer instead of broadcasting.
+var peerNicks = make(map[string]peer.ID)
+var peerNicksMu sync.Mutex
+
+// isSwarmKeyMismatch reports whether err is a pnet handshake failure, i.e.
+// the peer is on a different private network (wrong or missing swarm key).
+//
+// pnet's PSK transport is a plain stream cipher with no handshake-level
+// mismatch signal, so a wrong PSK just produces garbled bytes that fail
+// further up the stack (multistream-select, security negotiation) with
+// generic errors like EOF or "failed to negotiate protocol". pnet.IsPNetError
+// is the one place that wraps those failures distinctly, so that's what we
+// check instead of guessing at error text.
+func isSwarmKeyMismatch(err error) bool {
+	return pnet.IsPNetError(err)
+}
+
+func runGenSwarmKey(args []string) {
+	path := "swarm.key"
+	if len(args) > 0 {
+		path = args[0]
+	}
+	if err := p2p.GenerateSwarmKey(path); err != nil {
+		log.Fatal("Error generating swarm key:", err)
+	}
+	fmt.Println("Swarm key written to", path)
+}
+
 func main() {
+	// `talklocal gen-swarm-key <path>` writes a new private network key and
+	// exits, rather than starting a node.
+	if len(os.Args) > 1 && os.Args[1] == "gen-swarm-key" {
+		runGenSwarmKey(os.Args[2:])
+		return
+	}
+
 	port := flag.String("port", "", "port")
 	nickFlag := flag.String("nick", "", "nickname to use in chat. will be generated if empty")
 	sameNetworkString := flag.String("same_string", "", "same_string for mDNS discovery")
+	bootstrapFlag := flag.String("bootstrap", "", "comma-separated bootstrap multiaddrs for DHT discovery (defaults to the public IPFS bootstrap peers)")
+	relayFlag := flag.Bool("relay", false, "enable libp2p Circuit Relay v2 client mode, for peers behind a NAT")
+	identityFlag := flag.String("identity", "", "path to a persisted identity key; generated and saved there if missing. A fresh, non-persisted key is used if empty")
+	swarmKeyFlag := flag.String("swarm-key", "", "path to a pre-shared key file; when set, only peers with the same key can join the swarm")
 	flag.Parse()
 
+	// Load (or generate) this node's identity key, so its peer ID is stable
+	// across restarts when --identity is given.
+	priv, err := p2p.LoadOrGenerateIdentity(*identityFlag)
+	if err != nil {
+		log.Fatal("Error loading identity key:", err)
+	}
+
+	var psk pnet.PSK
+	if *swarmKeyFlag != "" {
+		psk, err = p2p.LoadSwarmKey(*swarmKeyFlag)
+		if err != nil {
+			log.Fatal("Error loading swarm key:", err)
+		}
+	}
+
 	// Create libp2p host
-	h, _, err := p2p.CreateHost(*port)
+	h, err := p2p.CreateHost(*port, *relayFlag, priv, psk)
 	if err != nil {
 		log.Fatal("Error creating the host:", err)
 	}
 	ctx := context.Background()
 
+	// Register the block exchange protocol so we can both serve chunks of
+	// files we've shared and fetch chunks of files other peers have shared.
+	fileshare.InitBlockExchange(h)
+
+	// Register the request/response file protocol so a specific peer can be
+	// asked directly for a file instead of broadcasting the request.
+	fileshare.InitFileRequestHandler(h)
+
 	// Setup PubSub
 	ps, err := pubsub.NewGossipSub(ctx, h)
 	if err != nil {
 		log.Fatal("Error creating pubsub:", err)
 	}
 
-	// mDNS peer discovery
-	peerChan := p2p.InitMDNS(h, *sameNetworkString)
 	green := color.New(color.FgGreen).SprintFunc()
 	yellow := color.New(color.FgYellow).SprintFunc()
 
-	go func() {
-		for peer := range peerChan {
-			fmt.Println()
-			fmt.Println(green("New Peer Found:"))
-			if peer.ID > h.ID() {
-				fmt.Println(green("Found peer:", peer, " id is greater than us, wait for it to connect to us"))
-				continue
-			}
-			fmt.Println(yellow("Discovered new peer via mDNS:", peer.ID, peer.Addrs))
+	// Connected peers are deduped so mDNS and DHT discovery, which can both
+	// surface the same peer, don't race to dial it twice.
+	connected := make(map[string]bool)
+	var connectedMu sync.Mutex
+
+	connectToPeer := func(source string, pi peer.AddrInfo) {
+		if pi.ID == h.ID() {
+			return
+		}
 
-			if err := h.Connect(ctx, peer); err != nil {
+		connectedMu.Lock()
+		if connected[pi.ID.String()] {
+			connectedMu.Unlock()
+			return
+		}
+		connected[pi.ID.String()] = true
+		connectedMu.Unlock()
+
+		fmt.Println()
+		fmt.Println(yellow("Discovered new peer via "+source+":", pi.ID, pi.Addrs))
+
+		if err := h.Connect(ctx, pi); err != nil {
+			// A mismatched --swarm-key rejects the handshake for every peer
+			// outside our private network; that's expected noise on mDNS,
+			// not a real connection failure, so it only gets a debug log.
+			if source == "mDNS" && isSwarmKeyMismatch(err) {
+				log.Printf("[debug] mDNS peer %s rejected (swarm key mismatch)", pi.ID)
+			} else {
 				fmt.Println("Connection failed:", err)
+			}
+			connectedMu.Lock()
+			delete(connected, pi.ID.String())
+			connectedMu.Unlock()
+			return
+		}
+		log.Println(green("Connected to peer via "+source+":", pi.ID))
+	}
+
+	// mDNS peer discovery
+	mdnsPeerChan := p2p.InitMDNS(h, *sameNetworkString)
+	go func() {
+		for pi := range mdnsPeerChan {
+			if pi.ID > h.ID() {
+				fmt.Println(green("Found peer:", pi, " id is greater than us, wait for it to connect to us"))
 				continue
 			}
-			log.Println(green("Connected to peer via mDNS:", peer.ID))
+			connectToPeer("mDNS", pi)
 		}
 	}()
 
+	// DHT + rendezvous peer discovery, for peers that aren't on the same LAN
+	var bootstrapAddrs []string
+	if *bootstrapFlag != "" {
+		bootstrapAddrs = strings.Split(*bootstrapFlag, ",")
+	}
+	kdht, err := p2p.InitDHT(ctx, h, bootstrapAddrs)
+	if err != nil {
+		log.Println("DHT discovery disabled:", err)
+	} else {
+		dhtPeerChan, err := p2p.FindPeersByRendezvous(ctx, h, kdht, *sameNetworkString)
+		if err != nil {
+			log.Println("DHT rendezvous discovery disabled:", err)
+		} else {
+			go func() {
+				for pi := range dhtPeerChan {
+					connectToPeer("DHT", pi)
+				}
+			}()
+		}
+	}
+
 	// Nickname setup
 	nick := *nickFlag
 	if len(nick) == 0 {
 		nick = "KUNJ"
 	}
 
+	// Pubsub-based peer discovery: once two peers meet through any path
+	// (mDNS, DHT, a manual dial) this lets the whole mesh converge without
+	// every pair needing to independently discover each other.
+	pspd, err := p2p.NewPubSubPeerDiscovery(ps, h, priv, *sameNetworkString, 30*time.Second)
+	if err != nil {
+		log.Println("Pubsub peer discovery disabled:", err)
+	} else {
+		pspd.Start(ctx)
+	}
+
 	// Join room discovery topic
-	discoveryRoom, err := p2p.JoinDiscoveryRoom(ctx, ps, h.ID(), nick)
+	discoveryRoom, err := p2p.JoinDiscoveryRoom(ctx, ps, priv, nick)
 	if err != nil {
 		log.Fatal("Failed to join room discovery topic:", err)
 	}
@@ -149,7 +275,7 @@ func main() {
 			}
 			roomName = strings.TrimSpace(roomName)
 
-			cr, err = p2p.JoinChatRoom(ctx, ps, h.ID(), nick, roomName)
+			cr, err = p2p.JoinChatRoom(ctx, ps, priv, nick, roomName)
 			if err != nil {
 				fmt.Println("Failed to join room:", err)
 				continue
@@ -167,6 +293,12 @@ func main() {
 			go func() {
 				blue := color.New(color.FgBlue).SprintFunc()
 				for msg := range cr.Messages {
+					if senderID, err := peer.Decode(msg.SenderID); err == nil {
+						peerNicksMu.Lock()
+						peerNicks[msg.SenderNick] = senderID
+						peerNicksMu.Unlock()
+					}
+
 					text := fmt.Sprintf("Received message at %s from %s: %s\n", time.Now().Local(), msg.SenderNick, msg.Message)
 					fmt.Print(blue(text))
 					fmt.Print("> Enter message (or /exit to leave): ")
@@ -195,13 +327,16 @@ func main() {
 					scanner.Scan()
 					filePath := strings.TrimSpace(scanner.Text())
 
-					cid, err := fileshare.AddFileToOfflineStore(filePath)
+					fileCid, err := fileshare.AddFileToOfflineStore(filePath)
 					if err != nil {
 						log.Printf("Error adding file to store: %v", err)
 						continue
 					}
 
-					fmt.Println("File uploaded successfully! CID:", cid.String())
+					fmt.Println("File chunked and stored! CID:", fileCid.String())
+					if err := cr.Publish("/file " + fileCid.String()); err != nil {
+						log.Printf("Error announcing file to room: %v", err)
+					}
 				}
 
 				// Handle file retrieve command
@@ -216,13 +351,53 @@ func main() {
 						continue
 					}
 
-					fileData, err := fileshare.RetrieveFileFromStore(fileCid)
-					if err != nil {
+					fmt.Print("Enter destination path to save the file: ")
+					scanner.Scan()
+					dstPath := strings.TrimSpace(scanner.Text())
+
+					fmt.Print("Enter peer nickname to fetch directly from (leave blank to broadcast): ")
+					scanner.Scan()
+					peerNick := strings.TrimSpace(scanner.Text())
+
+					if peerNick != "" {
+						peerNicksMu.Lock()
+						peerID, ok := peerNicks[peerNick]
+						peerNicksMu.Unlock()
+						if !ok {
+							fmt.Println("Unknown peer nickname:", peerNick)
+							continue
+						}
+
+						fmt.Println("Requesting file", fileCid, "from", peerNick, "...")
+						progressCh, err := fileshare.RequestFileFromPeer(ctx, h, peerID, fileCid, dstPath)
+						if err != nil {
+							log.Printf("Error requesting file from %s: %v", peerNick, err)
+							continue
+						}
+						var transferErr error
+						for p := range progressCh {
+							if p.Err != nil {
+								transferErr = p.Err
+								log.Printf("Transfer failed: %v", p.Err)
+								break
+							}
+							fmt.Printf("\r%d/%d bytes (eta %s)  ", p.Transferred, p.Total, p.ETA.Round(time.Second))
+						}
+						fmt.Println()
+						if transferErr != nil {
+							continue
+						}
+						fmt.Println("File saved to", dstPath)
+						continue
+					}
+
+					fmt.Println("Fetching file", fileCid, "from the network...")
+					if err := fileshare.RetrieveFileFromStore(fileCid, dstPath); err != nil {
 						log.Printf("Error retrieving file with CID '%s': %v", cidStr, err)
 						continue
 					}
 
-					fmt.Println("Retrieved file data:", string(fileData))
+					fmt.Println("File saved to", dstPath)
 				}
 
 				if line == "" {
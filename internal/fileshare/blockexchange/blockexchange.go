@@ -0,0 +1,192 @@
+// Package blockexchange implements a small Bitswap-style block exchange
+// protocol over libp2p streams: a peer looking for a CID asks connected
+// peers WANT_HAVE, those that have it reply HAVE, and the requester then
+// opens a WANT_BLOCK to fetch the actual bytes.
+package blockexchange
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/ipfs/boxo/blockstore"
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ProtocolID is the libp2p stream protocol used to exchange blocks.
+const ProtocolID = "/talklocal/blockexchange/1.0.0"
+
+type msgType string
+
+const (
+	msgWantHave  msgType = "WANT_HAVE"
+	msgWantBlock msgType = "WANT_BLOCK"
+	msgHave      msgType = "HAVE"
+	msgDontHave  msgType = "DONT_HAVE"
+	msgBlock     msgType = "BLOCK"
+)
+
+type message struct {
+	Type msgType `json:"type"`
+	CID  string  `json:"cid"`
+	Data []byte  `json:"data,omitempty"`
+}
+
+func writeMessage(w *bufio.Writer, m message) error {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error marshalling blockexchange message: %v", err)
+	}
+	raw = append(raw, '\n')
+	if _, err := w.Write(raw); err != nil {
+		return fmt.Errorf("error writing blockexchange message: %v", err)
+	}
+	return w.Flush()
+}
+
+func readMessage(r *bufio.Reader) (message, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return message{}, fmt.Errorf("error reading blockexchange message: %v", err)
+	}
+	var m message
+	if err := json.Unmarshal(line, &m); err != nil {
+		return message{}, fmt.Errorf("error decoding blockexchange message: %v", err)
+	}
+	return m, nil
+}
+
+// Exchange serves blocks from a local blockstore to peers over ProtocolID
+// and fetches blocks missing locally from connected peers.
+type Exchange struct {
+	h  host.Host
+	bs blockstore.Blockstore
+}
+
+// New registers the block exchange stream handler on h and returns an
+// Exchange that can both serve and fetch blocks backed by bs.
+func New(h host.Host, bs blockstore.Blockstore) *Exchange {
+	ex := &Exchange{h: h, bs: bs}
+	h.SetStreamHandler(ProtocolID, ex.handleStream)
+	return ex
+}
+
+func (ex *Exchange) handleStream(s network.Stream) {
+	defer s.Close()
+
+	r := bufio.NewReader(s)
+	w := bufio.NewWriter(s)
+
+	for {
+		req, err := readMessage(r)
+		if err != nil {
+			return
+		}
+
+		c, err := cid.Decode(req.CID)
+		if err != nil {
+			log.Printf("blockexchange: received invalid CID %q: %v", req.CID, err)
+			return
+		}
+
+		switch req.Type {
+		case msgWantHave:
+			has, err := ex.bs.Has(context.Background(), c)
+			if err != nil {
+				log.Printf("blockexchange: error checking for block %s: %v", c, err)
+				return
+			}
+			reply := message{Type: msgDontHave, CID: req.CID}
+			if has {
+				reply.Type = msgHave
+			}
+			if err := writeMessage(w, reply); err != nil {
+				return
+			}
+
+		case msgWantBlock:
+			blk, err := ex.bs.Get(context.Background(), c)
+			if err != nil {
+				_ = writeMessage(w, message{Type: msgDontHave, CID: req.CID})
+				return
+			}
+			if err := writeMessage(w, message{Type: msgBlock, CID: req.CID, Data: blk.RawData()}); err != nil {
+				return
+			}
+
+		default:
+			return
+		}
+	}
+}
+
+// GetBlock fetches c from the blockstore passed to New, or, if missing
+// locally, from any connected peer that reports having it.
+func (ex *Exchange) GetBlock(ctx context.Context, c cid.Cid) (block.Block, error) {
+	if blk, err := ex.bs.Get(ctx, c); err == nil {
+		return blk, nil
+	}
+
+	for _, p := range ex.h.Network().Peers() {
+		blk, err := ex.fetchFrom(ctx, p, c)
+		if err != nil {
+			continue
+		}
+		return blk, nil
+	}
+
+	return nil, fmt.Errorf("block %s not found locally or on any connected peer", c)
+}
+
+func (ex *Exchange) fetchFrom(ctx context.Context, p peer.ID, c cid.Cid) (block.Block, error) {
+	s, err := ex.h.NewStream(ctx, p, ProtocolID)
+	if err != nil {
+		return nil, fmt.Errorf("error opening blockexchange stream to %s: %v", p, err)
+	}
+	defer s.Close()
+
+	r := bufio.NewReader(s)
+	w := bufio.NewWriter(s)
+
+	if err := writeMessage(w, message{Type: msgWantHave, CID: c.String()}); err != nil {
+		return nil, err
+	}
+	have, err := readMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	if have.Type != msgHave {
+		return nil, fmt.Errorf("peer %s does not have block %s", p, c)
+	}
+
+	if err := writeMessage(w, message{Type: msgWantBlock, CID: c.String()}); err != nil {
+		return nil, err
+	}
+	resp, err := readMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Type != msgBlock {
+		return nil, fmt.Errorf("peer %s failed to send block %s", p, c)
+	}
+
+	// block.NewBlockWithCid only checks the hash when go-ipfs-util's global
+	// Debug flag is set, so a buggy or malicious peer could otherwise hand
+	// back arbitrary bytes for our requested CID. Verify explicitly instead
+	// of relying on that opt-in check.
+	sum, err := c.Prefix().Sum(resp.Data)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing block received from %s: %v", p, err)
+	}
+	if !sum.Equals(c) {
+		return nil, fmt.Errorf("peer %s sent data that does not hash to requested CID %s", p, c)
+	}
+
+	return block.NewBlockWithCid(resp.Data, c)
+}
@@ -0,0 +1,100 @@
+package blockexchange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	"github.com/ipfs/boxo/blockstore"
+	block "github.com/ipfs/go-block-format"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newTestBlockstore() blockstore.Blockstore {
+	return blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+}
+
+func TestGetBlockRoundTrip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	h1, err := libp2p.New()
+	if err != nil {
+		t.Fatalf("libp2p.New: %v", err)
+	}
+	defer h1.Close()
+	h2, err := libp2p.New()
+	if err != nil {
+		t.Fatalf("libp2p.New: %v", err)
+	}
+	defer h2.Close()
+
+	if err := h1.Connect(ctx, peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	bs1 := newTestBlockstore()
+	bs2 := newTestBlockstore()
+	New(h1, bs1)
+	ex2 := New(h2, bs2)
+
+	want := block.NewBlock([]byte("hello from peer 1"))
+	if err := bs1.Put(ctx, want); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	got, err := ex2.GetBlock(ctx, want.Cid())
+	if err != nil {
+		t.Fatalf("GetBlock: %v", err)
+	}
+	if string(got.RawData()) != string(want.RawData()) {
+		t.Fatalf("GetBlock returned %q, want %q", got.RawData(), want.RawData())
+	}
+}
+
+func TestGetBlockRejectsCorruptedBlock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	h1, err := libp2p.New()
+	if err != nil {
+		t.Fatalf("libp2p.New: %v", err)
+	}
+	defer h1.Close()
+	h2, err := libp2p.New()
+	if err != nil {
+		t.Fatalf("libp2p.New: %v", err)
+	}
+	defer h2.Close()
+
+	if err := h1.Connect(ctx, peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	bs1 := newTestBlockstore()
+	bs2 := newTestBlockstore()
+	New(h1, bs1)
+	ex2 := New(h2, bs2)
+
+	real := block.NewBlock([]byte("the real content"))
+
+	// Store the wrong bytes under the real block's CID. block.NewBlockWithCid
+	// only checks the hash when go-ipfs-util's Debug flag is set (false by
+	// default), so this simulates a buggy or malicious peer answering a
+	// WANT_BLOCK with data that doesn't hash to the requested CID.
+	corrupted, err := block.NewBlockWithCid([]byte("not the real content"), real.Cid())
+	if err != nil {
+		t.Fatalf("NewBlockWithCid: %v", err)
+	}
+	if err := bs1.Put(ctx, corrupted); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if _, err := ex2.GetBlock(ctx, real.Cid()); err == nil {
+		t.Fatalf("GetBlock succeeded with data that doesn't hash to the requested CID")
+	}
+}
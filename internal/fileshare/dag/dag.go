@@ -0,0 +1,295 @@
+// Package dag implements a small UnixFS-style Merkle DAG: files are split
+// into fixed-size chunks stored as leaf blocks, and those leaves are linked
+// together through one or more layers of inner nodes, each holding ordered
+// links to its children plus the cumulative size of the subtree they cover.
+package dag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/boxo/blockstore"
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+// ChunkSize is the size of each leaf block. 256 KiB matches the default
+// chunk size used by go-ipfs/kubo.
+const ChunkSize = 256 * 1024
+
+// MaxLinksPerNode caps how many children a single inner node may link to.
+// Without this, a large file's root node would hold a direct link to every
+// leaf chunk and itself become one multi-megabyte block; capping fan-out
+// keeps every stored/transmitted block small regardless of file size, at
+// the cost of extra inner-node layers for bigger files.
+const MaxLinksPerNode = 174
+
+// Link points to a child node and records its size, so a reader can walk
+// the DAG without fetching every child just to learn its length.
+type Link struct {
+	CID  cid.Cid `json:"cid"`
+	Size uint64  `json:"size"`
+}
+
+// Node is either a leaf (raw chunk bytes, no links) or an inner node
+// (ordered links to children, no data of its own).
+type Node struct {
+	Data  []byte `json:"data,omitempty"`
+	Links []Link `json:"links,omitempty"`
+	Size  uint64 `json:"size"`
+}
+
+func (n *Node) encode() ([]byte, error) {
+	return json.Marshal(n)
+}
+
+func decodeNode(raw []byte) (*Node, error) {
+	n := new(Node)
+	if err := json.Unmarshal(raw, n); err != nil {
+		return nil, fmt.Errorf("error decoding dag node: %v", err)
+	}
+	return n, nil
+}
+
+func blockFromNode(n *Node) (block.Block, error) {
+	raw, err := n.encode()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding dag node: %v", err)
+	}
+	return block.NewBlock(raw), nil
+}
+
+// Build reads r in ChunkSize pieces, stores each piece as a leaf block in
+// bs, then links the leaves together through as many layers of inner nodes
+// as needed to keep every node's fan-out within MaxLinksPerNode. It returns
+// the CID of the root node, which is all a peer needs to retrieve the whole
+// file later.
+func Build(ctx context.Context, bs blockstore.Blockstore, r io.Reader) (cid.Cid, error) {
+	var leaves []Link
+	buf := make([]byte, ChunkSize)
+
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			leaf := &Node{Data: append([]byte(nil), buf[:n]...), Size: uint64(n)}
+			blk, err := blockFromNode(leaf)
+			if err != nil {
+				return cid.Undef, err
+			}
+			if err := bs.Put(ctx, blk); err != nil {
+				return cid.Undef, fmt.Errorf("error storing leaf block: %v", err)
+			}
+			leaves = append(leaves, Link{CID: blk.Cid(), Size: uint64(n)})
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return cid.Undef, fmt.Errorf("error reading input: %v", readErr)
+		}
+	}
+
+	return buildRoot(ctx, bs, leaves)
+}
+
+// buildRoot links children into a single root node, inserting as many
+// layers of intermediate nodes as needed so that no node holds more than
+// MaxLinksPerNode links. An empty file is represented by a root node with
+// no links and no data.
+func buildRoot(ctx context.Context, bs blockstore.Blockstore, children []Link) (cid.Cid, error) {
+	for len(children) > MaxLinksPerNode {
+		var next []Link
+		for i := 0; i < len(children); i += MaxLinksPerNode {
+			end := i + MaxLinksPerNode
+			if end > len(children) {
+				end = len(children)
+			}
+			group := children[i:end]
+
+			inner := &Node{Links: append([]Link(nil), group...)}
+			for _, l := range group {
+				inner.Size += l.Size
+			}
+
+			blk, err := blockFromNode(inner)
+			if err != nil {
+				return cid.Undef, err
+			}
+			if err := bs.Put(ctx, blk); err != nil {
+				return cid.Undef, fmt.Errorf("error storing inner node: %v", err)
+			}
+
+			next = append(next, Link{CID: blk.Cid(), Size: inner.Size})
+		}
+		children = next
+	}
+
+	root := &Node{Links: children}
+	for _, l := range children {
+		root.Size += l.Size
+	}
+
+	rootBlk, err := blockFromNode(root)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err := bs.Put(ctx, rootBlk); err != nil {
+		return cid.Undef, fmt.Errorf("error storing root node: %v", err)
+	}
+
+	return rootBlk.Cid(), nil
+}
+
+// FetchFunc retrieves a block that is missing from the local blockstore,
+// typically over the network.
+type FetchFunc func(ctx context.Context, c cid.Cid) (block.Block, error)
+
+func loadBlock(ctx context.Context, bs blockstore.Blockstore, c cid.Cid, fetch FetchFunc) (block.Block, error) {
+	if blk, err := bs.Get(ctx, c); err == nil {
+		return blk, nil
+	}
+	if fetch == nil {
+		return nil, fmt.Errorf("block %s not found locally and no fetch func was given", c)
+	}
+
+	blk, err := fetch(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching block %s: %v", c, err)
+	}
+	if err := bs.Put(ctx, blk); err != nil {
+		return nil, fmt.Errorf("error caching fetched block %s: %v", c, err)
+	}
+	return blk, nil
+}
+
+// GetNode fetches and decodes the node for c, without walking its children.
+func GetNode(ctx context.Context, bs blockstore.Blockstore, c cid.Cid, fetch FetchFunc) (*Node, error) {
+	blk, err := loadBlock(ctx, bs, c, fetch)
+	if err != nil {
+		return nil, err
+	}
+	return decodeNode(blk.RawData())
+}
+
+// Walk reassembles the file rooted at root into w in order, fetching any
+// blocks missing from bs via fetch. fetch may be nil if every block is
+// already expected to be local. It recurses through however many layers of
+// inner nodes the DAG has.
+func Walk(ctx context.Context, bs blockstore.Blockstore, root cid.Cid, w io.Writer, fetch FetchFunc) error {
+	node, err := GetNode(ctx, bs, root, fetch)
+	if err != nil {
+		return err
+	}
+	return walkNode(ctx, bs, node, w, fetch)
+}
+
+func walkNode(ctx context.Context, bs blockstore.Blockstore, node *Node, w io.Writer, fetch FetchFunc) error {
+	if len(node.Links) == 0 {
+		_, err := w.Write(node.Data)
+		return err
+	}
+
+	for _, link := range node.Links {
+		child, err := GetNode(ctx, bs, link.CID, fetch)
+		if err != nil {
+			return err
+		}
+		if err := walkNode(ctx, bs, child, w, fetch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WalkRange is like Walk, but only delivers the bytes in [offset,
+// offset+length) to onLeaf, in order, as they become available. A length
+// <= 0 means "until EOF". Subtrees entirely outside the requested range
+// are skipped without being fetched, using the sizes recorded in each
+// Link, so serving a small range of a large file does not require touching
+// every block.
+func WalkRange(ctx context.Context, bs blockstore.Blockstore, root cid.Cid, offset, length int64, fetch FetchFunc, onLeaf func(data []byte) error) error {
+	node, err := GetNode(ctx, bs, root, fetch)
+	if err != nil {
+		return err
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+	if length <= 0 || offset+length > int64(node.Size) {
+		length = int64(node.Size) - offset
+	}
+	if length <= 0 {
+		return nil
+	}
+
+	_, err = walkRangeNode(ctx, bs, node, 0, offset, offset+length, fetch, onLeaf)
+	return err
+}
+
+// walkRangeNode visits node, which covers file offsets [nodeStart,
+// nodeStart+node.Size), delivering the portion of it that falls inside
+// [from, to) to onLeaf.
+func walkRangeNode(ctx context.Context, bs blockstore.Blockstore, node *Node, nodeStart, from, to int64, fetch FetchFunc, onLeaf func(data []byte) error) (int64, error) {
+	nodeEnd := nodeStart + int64(node.Size)
+	if nodeEnd <= from || nodeStart >= to {
+		return 0, nil
+	}
+
+	if len(node.Links) == 0 {
+		start := int64(0)
+		if nodeStart < from {
+			start = from - nodeStart
+		}
+		end := int64(len(node.Data))
+		if nodeEnd > to {
+			end -= nodeEnd - to
+		}
+		if start >= end {
+			return 0, nil
+		}
+
+		chunk := node.Data[start:end]
+		if err := onLeaf(chunk); err != nil {
+			return 0, err
+		}
+		return int64(len(chunk)), nil
+	}
+
+	var delivered int64
+	pos := nodeStart
+	for _, link := range node.Links {
+		linkEnd := pos + int64(link.Size)
+		if linkEnd > from && pos < to {
+			child, err := GetNode(ctx, bs, link.CID, fetch)
+			if err != nil {
+				return delivered, err
+			}
+			n, err := walkRangeNode(ctx, bs, child, pos, from, to, fetch, onLeaf)
+			delivered += n
+			if err != nil {
+				return delivered, err
+			}
+		}
+		pos = linkEnd
+	}
+
+	return delivered, nil
+}
+
+// Size returns the total file size recorded in the root node, fetching it
+// via fetch if it is not already in bs.
+func Size(ctx context.Context, bs blockstore.Blockstore, root cid.Cid, fetch FetchFunc) (uint64, error) {
+	rootBlk, err := loadBlock(ctx, bs, root, fetch)
+	if err != nil {
+		return 0, err
+	}
+	rootNode, err := decodeNode(rootBlk.RawData())
+	if err != nil {
+		return 0, err
+	}
+	return rootNode.Size, nil
+}
@@ -0,0 +1,118 @@
+package dag
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	"github.com/ipfs/boxo/blockstore"
+)
+
+func newTestBlockstore() blockstore.Blockstore {
+	return blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+}
+
+func TestBuildWalkRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	bs := newTestBlockstore()
+
+	// Several full chunks plus a short final one, so the root links more
+	// than one leaf and the last leaf is smaller than ChunkSize.
+	want := make([]byte, ChunkSize*5+123)
+	if _, err := rand.Read(want); err != nil {
+		t.Fatalf("error generating test data: %v", err)
+	}
+
+	root, err := Build(ctx, bs, bytes.NewReader(want))
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	size, err := Size(ctx, bs, root, nil)
+	if err != nil {
+		t.Fatalf("Size: %v", err)
+	}
+	if size != uint64(len(want)) {
+		t.Fatalf("Size = %d, want %d", size, len(want))
+	}
+
+	var got bytes.Buffer
+	if err := Walk(ctx, bs, root, &got, nil); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Fatalf("Walk produced %d bytes, want %d bytes matching the original", got.Len(), len(want))
+	}
+}
+
+func TestWalkRangeMiddleOfFile(t *testing.T) {
+	ctx := context.Background()
+	bs := newTestBlockstore()
+
+	want := make([]byte, ChunkSize*3+100)
+	if _, err := rand.Read(want); err != nil {
+		t.Fatalf("error generating test data: %v", err)
+	}
+
+	root, err := Build(ctx, bs, bytes.NewReader(want))
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	offset := int64(ChunkSize) - 10
+	length := int64(40)
+
+	var got bytes.Buffer
+	err = WalkRange(ctx, bs, root, offset, length, nil, func(data []byte) error {
+		_, err := got.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WalkRange: %v", err)
+	}
+
+	wantRange := want[offset : offset+length]
+	if !bytes.Equal(got.Bytes(), wantRange) {
+		t.Fatalf("WalkRange produced %d bytes, want %d bytes matching the requested range", got.Len(), len(wantRange))
+	}
+}
+
+func TestBuildManyLayers(t *testing.T) {
+	ctx := context.Background()
+	bs := newTestBlockstore()
+
+	// Enough chunks to require at least two layers of inner nodes above the
+	// leaves, given MaxLinksPerNode.
+	want := make([]byte, ChunkSize*(MaxLinksPerNode+1))
+	if _, err := rand.Read(want); err != nil {
+		t.Fatalf("error generating test data: %v", err)
+	}
+
+	root, err := Build(ctx, bs, bytes.NewReader(want))
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	rootNode, err := GetNode(ctx, bs, root, nil)
+	if err != nil {
+		t.Fatalf("GetNode: %v", err)
+	}
+	if len(rootNode.Links) > MaxLinksPerNode {
+		t.Fatalf("root node has %d links, want <= %d", len(rootNode.Links), MaxLinksPerNode)
+	}
+	if len(rootNode.Data) != 0 {
+		t.Fatalf("root node holds %d bytes of data directly; inner nodes should only hold links", len(rootNode.Data))
+	}
+
+	var got bytes.Buffer
+	if err := Walk(ctx, bs, root, &got, nil); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Fatalf("Walk produced %d bytes, want %d bytes matching the original", got.Len(), len(want))
+	}
+}
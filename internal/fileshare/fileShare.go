@@ -3,65 +3,109 @@ package fileshare
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
 	"sync"
 
+	"talkLocally/internal/fileshare/blockexchange"
+	"talkLocally/internal/fileshare/dag"
+	"talkLocally/internal/fileshare/filerequest"
+
 	"github.com/ipfs/boxo/blockstore"
-	block "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
-	"github.com/ipfs/go-datastore"
+	flatfs "github.com/ipfs/go-ds-flatfs"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
-// Global blockstore instance
+// blockstoreDir is where chunked file blocks are persisted on disk, so
+// shared files and the blocks needed to serve them survive a restart.
+const blockstoreDir = "blocks"
+
+// Global blockstore and block-exchange instances
 var (
-	store blockstore.Blockstore
-	once  sync.Once
+	store    blockstore.Blockstore
+	once     sync.Once
+	exchange *blockexchange.Exchange
+	exOnce   sync.Once
 )
 
 // Initialize the blockstore (called once)
 func initBlockstore() blockstore.Blockstore {
 	once.Do(func() {
-		// We are using an in-memory datastore
-		store = blockstore.NewBlockstore(datastore.NewMapDatastore()) // No need to wrap with sync
+		// flatfs keeps one file per block on disk, keyed by CID.
+		ds, err := flatfs.CreateOrOpen(blockstoreDir, flatfs.NextToLast(2), false)
+		if err != nil {
+			log.Fatalf("error opening flatfs blockstore at %s: %v", blockstoreDir, err)
+		}
+		store = blockstore.NewBlockstore(ds)
 	})
 	return store
 }
 
-// AddFileToOfflineStore adds a file to the offline blockstore and returns the CID of the stored block
+// InitBlockExchange registers the block exchange protocol handler on h so
+// this node can serve blocks to peers and fetch blocks it doesn't have
+// locally. It must be called once before RetrieveFileFromStore.
+func InitBlockExchange(h host.Host) *blockexchange.Exchange {
+	exOnce.Do(func() {
+		exchange = blockexchange.New(h, initBlockstore())
+	})
+	return exchange
+}
+
+// InitFileRequestHandler registers the request/response file protocol on h,
+// so a peer with this nickname can be asked directly for a file instead of
+// having it broadcast to the whole chat room.
+func InitFileRequestHandler(h host.Host) {
+	filerequest.RegisterHandler(h, initBlockstore())
+}
+
+// RequestFileFromPeer fetches fileCid directly from peerID over the
+// request/response file protocol, writing it to dstPath and reporting
+// progress on the returned channel.
+func RequestFileFromPeer(ctx context.Context, h host.Host, peerID peer.ID, fileCid cid.Cid, dstPath string) (<-chan filerequest.Progress, error) {
+	return filerequest.RequestFile(ctx, h, peerID, fileCid, dstPath)
+}
+
+// AddFileToOfflineStore chunks filePath into a UnixFS-style Merkle DAG and
+// stores every block in the local blockstore. It returns the CID of the
+// DAG's root node, which is all a peer needs to retrieve the whole file.
 func AddFileToOfflineStore(filePath string) (cid.Cid, error) {
-	// Read the file data into memory
-	fileData, err := os.ReadFile(filePath)
+	f, err := os.Open(filePath)
 	if err != nil {
-		return cid.Cid{}, fmt.Errorf("error reading file: %v", err)
+		return cid.Cid{}, fmt.Errorf("error opening file: %v", err)
 	}
+	defer f.Close()
 
-	// Initialize blockstore
 	store := initBlockstore()
 
-	// Create a new block with the file data
-	blk := block.NewBlock(fileData)
-
-	// Store the block in the blockstore
-	err = store.Put(context.Background(), blk)
+	root, err := dag.Build(context.Background(), store, f)
 	if err != nil {
-		return cid.Cid{}, fmt.Errorf("error storing block: %v", err)
+		return cid.Cid{}, fmt.Errorf("error building file dag: %v", err)
 	}
 
-	// Return the CID of the stored block
-	return blk.Cid(), nil
+	return root, nil
 }
 
-// RetrieveFileFromStore retrieves a file from the offline blockstore by its CID
-func RetrieveFileFromStore(fileCid cid.Cid) ([]byte, error) {
-	// Initialize blockstore
+// RetrieveFileFromStore reassembles the file rooted at fileCid into dstPath,
+// fetching any blocks missing from the local blockstore from connected
+// peers over the block exchange registered by InitBlockExchange.
+func RetrieveFileFromStore(fileCid cid.Cid, dstPath string) error {
+	if exchange == nil {
+		return fmt.Errorf("block exchange not initialized: call InitBlockExchange first")
+	}
+
 	store := initBlockstore()
 
-	// Retrieve the block using the provided CID
-	blk, err := store.Get(context.Background(), fileCid)
+	dst, err := os.Create(dstPath)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving block: %v", err)
+		return fmt.Errorf("error creating destination file: %v", err)
+	}
+	defer dst.Close()
+
+	if err := dag.Walk(context.Background(), store, fileCid, dst, exchange.GetBlock); err != nil {
+		return fmt.Errorf("error retrieving file with cid %s: %v", fileCid, err)
 	}
 
-	// Return the raw data of the block
-	return blk.RawData(), nil
+	return nil
 }
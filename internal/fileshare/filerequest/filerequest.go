@@ -0,0 +1,269 @@
+// Package filerequest implements a higher-level request/response file
+// transfer protocol alongside the block exchange, served from the sender's
+// local blockstore: a receiver asks for a
+// byte range of a file by CID and the sender streams it back with
+// progress, a checksum, and a mimetype, and the receiver can cancel a
+// transfer mid-flight.
+package filerequest
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"talkLocally/internal/fileshare/dag"
+
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ProtocolID is the libp2p stream protocol used for file requests.
+const ProtocolID = "/talklocal/file-request/1.0.0"
+
+// Request asks for Length bytes of the file identified by CID, starting at
+// Offset. A Length of 0 means "until the end of the file".
+type Request struct {
+	CID    string
+	Offset int64
+	Length int64
+}
+
+type frame struct {
+	Kind     string `json:"kind"` // "meta" | "data" | "done" | "error" | "rst"
+	Data     []byte `json:"data,omitempty"`
+	Mimetype string `json:"mimetype,omitempty"`
+	Total    int64  `json:"total,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+func writeFrame(w *bufio.Writer, f frame) error {
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("error marshalling frame: %v", err)
+	}
+	raw = append(raw, '\n')
+	if _, err := w.Write(raw); err != nil {
+		return fmt.Errorf("error writing frame: %v", err)
+	}
+	return w.Flush()
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return frame{}, fmt.Errorf("error reading frame: %v", err)
+	}
+	var f frame
+	if err := json.Unmarshal(line, &f); err != nil {
+		return frame{}, fmt.Errorf("error decoding frame: %v", err)
+	}
+	return f, nil
+}
+
+// RegisterHandler registers the file-request stream handler on h, serving
+// ranges of any file whose blocks are present in bs.
+func RegisterHandler(h host.Host, bs blockstore.Blockstore) {
+	h.SetStreamHandler(ProtocolID, func(s network.Stream) {
+		defer s.Close()
+		serve(s, bs)
+	})
+}
+
+func serve(s network.Stream, bs blockstore.Blockstore) {
+	r := bufio.NewReader(s)
+	w := bufio.NewWriter(s)
+
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return
+	}
+
+	fileCid, err := cid.Decode(req.CID)
+	if err != nil {
+		_ = writeFrame(w, frame{Kind: "error", Message: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		// A client cancelling mid-transfer sends a single "rst" frame; any
+		// read error (including the stream closing) also ends the transfer.
+		for {
+			f, err := readFrame(r)
+			if err != nil || f.Kind == "rst" {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	total, err := dag.Size(ctx, bs, fileCid, nil)
+	if err != nil {
+		_ = writeFrame(w, frame{Kind: "error", Message: err.Error()})
+		return
+	}
+
+	length := req.Length
+	if length <= 0 || req.Offset+length > int64(total) {
+		length = int64(total) - req.Offset
+	}
+
+	var mimetype string
+	hasher := sha256.New()
+
+	err = dag.WalkRange(ctx, bs, fileCid, req.Offset, length, nil, func(data []byte) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if mimetype == "" {
+			mimetype = http.DetectContentType(data)
+			if err := writeFrame(w, frame{Kind: "meta", Mimetype: mimetype, Total: length}); err != nil {
+				return err
+			}
+		}
+
+		hasher.Write(data)
+		return writeFrame(w, frame{Kind: "data", Data: data})
+	})
+	if err != nil {
+		if mimetype == "" {
+			_ = writeFrame(w, frame{Kind: "error", Message: err.Error()})
+		}
+		return
+	}
+
+	if mimetype == "" {
+		_ = writeFrame(w, frame{Kind: "meta", Mimetype: "application/octet-stream", Total: length})
+	}
+
+	_ = writeFrame(w, frame{Kind: "done", Checksum: hex.EncodeToString(hasher.Sum(nil))})
+}
+
+// Progress reports how a RequestFile transfer is going.
+type Progress struct {
+	Transferred int64
+	Total       int64
+	ETA         time.Duration
+	Err         error
+}
+
+// RequestFile asks peerID for fileCid over ProtocolID and writes the result
+// to dstPath, reporting progress on the returned channel, which is closed
+// when the transfer finishes or fails. Cancelling ctx sends an RST frame to
+// the peer and aborts the transfer.
+func RequestFile(ctx context.Context, h host.Host, peerID peer.ID, fileCid cid.Cid, dstPath string) (<-chan Progress, error) {
+	s, err := h.NewStream(ctx, peerID, ProtocolID)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file-request stream to %s: %v", peerID, err)
+	}
+
+	w := bufio.NewWriter(s)
+	req := Request{CID: fileCid.String()}
+	raw, err := json.Marshal(req)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("error marshalling file request: %v", err)
+	}
+	raw = append(raw, '\n')
+	if _, err := w.Write(raw); err != nil || w.Flush() != nil {
+		s.Close()
+		return nil, fmt.Errorf("error sending file request: %v", err)
+	}
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("error creating destination file: %v", err)
+	}
+
+	progressCh := make(chan Progress, 8)
+
+	go func() {
+		defer close(progressCh)
+		defer s.Close()
+		defer dst.Close()
+
+		r := bufio.NewReader(s)
+
+		meta, err := readFrame(r)
+		if err != nil || meta.Kind != "meta" {
+			progressCh <- Progress{Err: fmt.Errorf("error reading file metadata: %v", err)}
+			return
+		}
+		total := meta.Total
+
+		hasher := sha256.New()
+		var transferred int64
+		start := time.Now()
+
+		for {
+			select {
+			case <-ctx.Done():
+				_ = writeFrame(w, frame{Kind: "rst"})
+				progressCh <- Progress{Transferred: transferred, Total: total, Err: ctx.Err()}
+				return
+			default:
+			}
+
+			f, err := readFrame(r)
+			if err != nil {
+				progressCh <- Progress{Transferred: transferred, Total: total, Err: err}
+				return
+			}
+
+			switch f.Kind {
+			case "data":
+				if _, err := dst.Write(f.Data); err != nil {
+					progressCh <- Progress{Transferred: transferred, Total: total, Err: err}
+					return
+				}
+				hasher.Write(f.Data)
+				transferred += int64(len(f.Data))
+
+				var eta time.Duration
+				if elapsed := time.Since(start).Seconds(); elapsed > 0 && transferred < total {
+					rate := float64(transferred) / elapsed
+					if rate > 0 {
+						eta = time.Duration(float64(total-transferred)/rate) * time.Second
+					}
+				}
+				progressCh <- Progress{Transferred: transferred, Total: total, ETA: eta}
+
+			case "done":
+				if hex.EncodeToString(hasher.Sum(nil)) != f.Checksum {
+					progressCh <- Progress{Transferred: transferred, Total: total, Err: fmt.Errorf("checksum mismatch")}
+				}
+				return
+
+			case "error":
+				progressCh <- Progress{Transferred: transferred, Total: total, Err: fmt.Errorf("peer error: %s", f.Message)}
+				return
+
+			default:
+				progressCh <- Progress{Transferred: transferred, Total: total, Err: fmt.Errorf("unexpected frame kind %q", f.Kind)}
+				return
+			}
+		}
+	}()
+
+	return progressCh, nil
+}
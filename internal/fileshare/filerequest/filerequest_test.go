@@ -0,0 +1,80 @@
+package filerequest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"talkLocally/internal/fileshare/dag"
+
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newTestBlockstore() blockstore.Blockstore {
+	return blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+}
+
+func TestRequestFileRoundTrip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	server, err := libp2p.New()
+	if err != nil {
+		t.Fatalf("libp2p.New: %v", err)
+	}
+	defer server.Close()
+	client, err := libp2p.New()
+	if err != nil {
+		t.Fatalf("libp2p.New: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	bs := newTestBlockstore()
+	RegisterHandler(server, bs)
+
+	want := make([]byte, dag.ChunkSize+500)
+	if _, err := rand.Read(want); err != nil {
+		t.Fatalf("error generating test data: %v", err)
+	}
+	fileCid, err := dag.Build(ctx, bs, bytes.NewReader(want))
+	if err != nil {
+		t.Fatalf("dag.Build: %v", err)
+	}
+
+	dstPath := filepath.Join(t.TempDir(), "out")
+	progressCh, err := RequestFile(ctx, client, server.ID(), fileCid, dstPath)
+	if err != nil {
+		t.Fatalf("RequestFile: %v", err)
+	}
+
+	var lastErr error
+	for p := range progressCh {
+		if p.Err != nil {
+			lastErr = p.Err
+		}
+	}
+	if lastErr != nil {
+		t.Fatalf("transfer failed: %v", lastErr)
+	}
+
+	got, err := os.ReadFile(dstPath)
+	if err != nil {
+		t.Fatalf("error reading destination file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("received %d bytes, want %d bytes matching the original file", len(got), len(want))
+	}
+}
@@ -0,0 +1,139 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const chatRoomTopicPrefix = "talklocal-chat-room-"
+
+// ChatMessage is a single verified message received inside a chat room.
+type ChatMessage struct {
+	Message    string
+	SenderID   string
+	SenderNick string
+}
+
+// ChatRoom represents a subscription to the pubsub topic backing a single
+// named chat room.
+type ChatRoom struct {
+	Messages chan *ChatMessage
+
+	ctx   context.Context
+	topic *pubsub.Topic
+	sub   *pubsub.Subscription
+
+	roomName string
+	selfID   peer.ID
+	priv     crypto.PrivKey
+	nick     string
+	seq      uint64
+
+	nickBindingsMu sync.Mutex
+	nickBindings   map[peer.ID]string
+}
+
+// JoinChatRoom subscribes to the pubsub topic for roomName and starts
+// delivering verified messages from other peers on Messages. priv signs
+// every outgoing message and its public key is used to derive the host's
+// peer ID.
+func JoinChatRoom(ctx context.Context, ps *pubsub.PubSub, priv crypto.PrivKey, nick, roomName string) (*ChatRoom, error) {
+	selfID, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving peer ID from identity key: %v", err)
+	}
+
+	topic, err := ps.Join(chatRoomTopicPrefix + roomName)
+	if err != nil {
+		return nil, fmt.Errorf("error joining chat room topic: %v", err)
+	}
+
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return nil, fmt.Errorf("error subscribing to chat room topic: %v", err)
+	}
+
+	cr := &ChatRoom{
+		Messages:     make(chan *ChatMessage, 32),
+		ctx:          ctx,
+		topic:        topic,
+		sub:          sub,
+		roomName:     roomName,
+		selfID:       selfID,
+		priv:         priv,
+		nick:         nick,
+		nickBindings: make(map[peer.ID]string),
+	}
+
+	go cr.readLoop()
+
+	return cr, nil
+}
+
+// RoomName returns the human readable room name this ChatRoom was joined with.
+func (cr *ChatRoom) RoomName() string {
+	return cr.roomName
+}
+
+// Publish signs message with this node's identity key and sends it to
+// every peer currently subscribed to the room.
+func (cr *ChatRoom) Publish(message string) error {
+	cr.seq++
+	rec := &MessageRecord{
+		SenderID:   cr.selfID,
+		SenderNick: cr.nick,
+		Timestamp:  time.Now().Unix(),
+		Body:       message,
+		Seq:        cr.seq,
+	}
+
+	envelope, err := SignMessage(cr.priv, rec)
+	if err != nil {
+		return fmt.Errorf("error signing chat message: %v", err)
+	}
+
+	return cr.topic.Publish(cr.ctx, envelope)
+}
+
+func (cr *ChatRoom) readLoop() {
+	for {
+		msg, err := cr.sub.Next(cr.ctx)
+		if err != nil {
+			close(cr.Messages)
+			return
+		}
+		if msg.ReceivedFrom == cr.selfID {
+			continue
+		}
+
+		rec, err := OpenMessage(msg.Data)
+		if err != nil {
+			log.Printf("chat room %s: dropping unverifiable message from %s: %v", cr.roomName, msg.ReceivedFrom, err)
+			continue
+		}
+
+		cr.nickBindingsMu.Lock()
+		bound, known := cr.nickBindings[rec.SenderID]
+		if !known {
+			cr.nickBindings[rec.SenderID] = rec.SenderNick
+		}
+		cr.nickBindingsMu.Unlock()
+		if known && bound != rec.SenderNick {
+			log.Printf("chat room %s: dropping message claiming nick %q from %s, previously bound to %q", cr.roomName, rec.SenderNick, rec.SenderID, bound)
+			continue
+		}
+
+		cr.Messages <- &ChatMessage{
+			Message:    rec.Body,
+			SenderID:   rec.SenderID.String(),
+			SenderNick: rec.SenderNick,
+		}
+	}
+}
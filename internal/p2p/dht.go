@@ -0,0 +1,87 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// InitDHT bootstraps a Kademlia DHT on h, connecting it to bootstrapAddrs
+// (the public IPFS bootstrap peers if none are given), so peers that aren't
+// on the same LAN can still find each other via FindPeersByRendezvous.
+func InitDHT(ctx context.Context, h host.Host, bootstrapAddrs []string) (*dht.IpfsDHT, error) {
+	kdht, err := dht.New(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("error creating DHT: %v", err)
+	}
+
+	if err := kdht.Bootstrap(ctx); err != nil {
+		return nil, fmt.Errorf("error bootstrapping DHT: %v", err)
+	}
+
+	addrs := bootstrapAddrs
+	if len(addrs) == 0 {
+		for _, p := range dht.DefaultBootstrapPeers {
+			addrs = append(addrs, p.String())
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		maddr, err := multiaddr.NewMultiaddr(addr)
+		if err != nil {
+			log.Printf("Invalid bootstrap address %q: %v", addr, err)
+			continue
+		}
+		pi, err := peer.AddrInfoFromP2pAddr(maddr)
+		if err != nil {
+			log.Printf("Invalid bootstrap peer address %q: %v", addr, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.Connect(ctx, *pi); err != nil {
+				log.Printf("Failed to connect to bootstrap peer %s: %v", pi.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return kdht, nil
+}
+
+// FindPeersByRendezvous advertises rendezvous on the DHT and returns a
+// channel of peers found under the same tag. This plays the same role as
+// InitMDNS but works across peers that aren't on the same physical LAN.
+func FindPeersByRendezvous(ctx context.Context, h host.Host, kdht *dht.IpfsDHT, rendezvous string) (<-chan peer.AddrInfo, error) {
+	routingDiscovery := routing.NewRoutingDiscovery(kdht)
+	dutil.Advertise(ctx, routingDiscovery, rendezvous)
+
+	found, err := routingDiscovery.FindPeers(ctx, rendezvous)
+	if err != nil {
+		return nil, fmt.Errorf("error searching for peers via DHT: %v", err)
+	}
+
+	out := make(chan peer.AddrInfo, 32)
+	go func() {
+		defer close(out)
+		for pi := range found {
+			if pi.ID == h.ID() || len(pi.Addrs) == 0 {
+				continue
+			}
+			out <- pi
+		}
+	}()
+
+	return out, nil
+}
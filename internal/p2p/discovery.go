@@ -0,0 +1,131 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const discoveryTopicName = "talklocal-room-discovery"
+
+// DiscoveryMessage announces that SenderID currently has roomName open.
+type DiscoveryMessage struct {
+	Message  string
+	SenderID string
+	Nick     string
+}
+
+// DiscoveryRoom is the pubsub topic peers use to advertise which chat rooms
+// they have open, so others can list and join them.
+type DiscoveryRoom struct {
+	Messages chan *DiscoveryMessage
+
+	ctx   context.Context
+	topic *pubsub.Topic
+	sub   *pubsub.Subscription
+
+	selfID peer.ID
+	priv   crypto.PrivKey
+	nick   string
+	seq    uint64
+
+	nickBindingsMu sync.Mutex
+	nickBindings   map[peer.ID]string
+}
+
+// JoinDiscoveryRoom subscribes to the well-known room discovery topic.
+// priv signs every outgoing announcement and its public key is used to
+// derive the host's peer ID.
+func JoinDiscoveryRoom(ctx context.Context, ps *pubsub.PubSub, priv crypto.PrivKey, nick string) (*DiscoveryRoom, error) {
+	selfID, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving peer ID from identity key: %v", err)
+	}
+
+	topic, err := ps.Join(discoveryTopicName)
+	if err != nil {
+		return nil, fmt.Errorf("error joining room discovery topic: %v", err)
+	}
+
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return nil, fmt.Errorf("error subscribing to room discovery topic: %v", err)
+	}
+
+	dr := &DiscoveryRoom{
+		Messages:     make(chan *DiscoveryMessage, 32),
+		ctx:          ctx,
+		topic:        topic,
+		sub:          sub,
+		selfID:       selfID,
+		priv:         priv,
+		nick:         nick,
+		nickBindings: make(map[peer.ID]string),
+	}
+
+	go dr.readLoop()
+
+	return dr, nil
+}
+
+// Publish signs roomName with this node's identity key and announces it to
+// every peer subscribed to the discovery topic.
+func (dr *DiscoveryRoom) Publish(roomName string) error {
+	dr.seq++
+	rec := &MessageRecord{
+		SenderID:   dr.selfID,
+		SenderNick: dr.nick,
+		Timestamp:  time.Now().Unix(),
+		Body:       roomName,
+		Seq:        dr.seq,
+	}
+
+	envelope, err := SignMessage(dr.priv, rec)
+	if err != nil {
+		return fmt.Errorf("error signing discovery message: %v", err)
+	}
+
+	return dr.topic.Publish(dr.ctx, envelope)
+}
+
+func (dr *DiscoveryRoom) readLoop() {
+	for {
+		msg, err := dr.sub.Next(dr.ctx)
+		if err != nil {
+			close(dr.Messages)
+			return
+		}
+		if msg.ReceivedFrom == dr.selfID {
+			continue
+		}
+
+		rec, err := OpenMessage(msg.Data)
+		if err != nil {
+			log.Printf("room discovery: dropping unverifiable message from %s: %v", msg.ReceivedFrom, err)
+			continue
+		}
+
+		dr.nickBindingsMu.Lock()
+		bound, known := dr.nickBindings[rec.SenderID]
+		if !known {
+			dr.nickBindings[rec.SenderID] = rec.SenderNick
+		}
+		dr.nickBindingsMu.Unlock()
+		if known && bound != rec.SenderNick {
+			log.Printf("room discovery: dropping message claiming nick %q from %s, previously bound to %q", rec.SenderNick, rec.SenderID, bound)
+			continue
+		}
+
+		dr.Messages <- &DiscoveryMessage{
+			Message:  rec.Body,
+			SenderID: rec.SenderID.String(),
+			Nick:     rec.SenderNick,
+		}
+	}
+}
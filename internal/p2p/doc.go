@@ -0,0 +1,10 @@
+// Package p2p provides the shared libp2p plumbing every node needs
+// regardless of which higher-level feature it's using: host construction
+// and identity (host.go), private network swarm keys (host.go), mDNS,
+// DHT/rendezvous and pubsub-based peer discovery (mdns.go, dht.go,
+// pubsub_discovery.go), pubsub-based chat rooms and room discovery
+// (chatroom.go, discovery.go), and
+// signed message envelopes (envelope.go). It has no dependency on the
+// file-transfer packages under internal/fileshare; those build on top of a
+// host constructed here the same way the chat commands do.
+package p2p
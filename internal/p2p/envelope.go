@@ -0,0 +1,86 @@
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+)
+
+const envelopeDomain = "talklocal-message"
+
+var envelopeCodec = []byte("/talklocal/message")
+
+// MessageRecord is the signed payload carried by every chat and
+// room-discovery pubsub message. The signature ties each message to the
+// peer ID whose key signed it; SenderNick is whatever that peer declares,
+// and two peer IDs may declare the same nickname.
+type MessageRecord struct {
+	SenderID   peer.ID
+	SenderNick string
+	Timestamp  int64
+	Body       string
+	Seq        uint64
+}
+
+// Domain implements record.Record.
+func (r *MessageRecord) Domain() string { return envelopeDomain }
+
+// Codec implements record.Record.
+func (r *MessageRecord) Codec() []byte { return envelopeCodec }
+
+// MarshalRecord implements record.Record.
+func (r *MessageRecord) MarshalRecord() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// UnmarshalRecord implements record.Record.
+func (r *MessageRecord) UnmarshalRecord(data []byte) error {
+	return json.Unmarshal(data, r)
+}
+
+func init() {
+	record.RegisterType(&MessageRecord{})
+}
+
+// SignMessage seals rec into a record.Envelope signed by priv, ready to
+// publish on a pubsub topic.
+func SignMessage(priv crypto.PrivKey, rec *MessageRecord) ([]byte, error) {
+	envelope, err := record.Seal(rec, priv)
+	if err != nil {
+		return nil, fmt.Errorf("error sealing message envelope: %v", err)
+	}
+	raw, err := envelope.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling message envelope: %v", err)
+	}
+	return raw, nil
+}
+
+// OpenMessage verifies and decodes a signed envelope produced by
+// SignMessage. It fails if the signature doesn't check out, or if the
+// envelope's signing key doesn't derive the peer ID the record claims to
+// be from.
+func OpenMessage(data []byte) (*MessageRecord, error) {
+	envelope, untyped, err := record.ConsumeEnvelope(data, envelopeDomain)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying message envelope: %v", err)
+	}
+
+	rec, ok := untyped.(*MessageRecord)
+	if !ok {
+		return nil, fmt.Errorf("unexpected record type in envelope")
+	}
+
+	signerID, err := peer.IDFromPublicKey(envelope.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving peer ID from envelope key: %v", err)
+	}
+	if signerID != rec.SenderID {
+		return nil, fmt.Errorf("envelope signer %s does not match declared sender %s", signerID, rec.SenderID)
+	}
+
+	return rec, nil
+}
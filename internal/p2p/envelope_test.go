@@ -0,0 +1,99 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestSignMessageOpenMessageRoundTrip(t *testing.T) {
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, -1, rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key pair: %v", err)
+	}
+	selfID, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("error deriving peer ID: %v", err)
+	}
+
+	rec := &MessageRecord{
+		SenderID:   selfID,
+		SenderNick: "alice",
+		Timestamp:  1234,
+		Body:       "hello",
+		Seq:        1,
+	}
+
+	envelope, err := SignMessage(priv, rec)
+	if err != nil {
+		t.Fatalf("SignMessage: %v", err)
+	}
+
+	got, err := OpenMessage(envelope)
+	if err != nil {
+		t.Fatalf("OpenMessage: %v", err)
+	}
+	if got.SenderID != rec.SenderID || got.SenderNick != rec.SenderNick || got.Body != rec.Body || got.Seq != rec.Seq {
+		t.Fatalf("OpenMessage returned %+v, want %+v", got, rec)
+	}
+}
+
+func TestOpenMessageRejectsSpoofedSender(t *testing.T) {
+	signerPriv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, -1, rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating signer key pair: %v", err)
+	}
+
+	otherPriv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, -1, rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating other key pair: %v", err)
+	}
+	otherID, err := peer.IDFromPrivateKey(otherPriv)
+	if err != nil {
+		t.Fatalf("error deriving peer ID: %v", err)
+	}
+
+	// rec claims to be from otherID, but is signed by a different key.
+	rec := &MessageRecord{
+		SenderID:   otherID,
+		SenderNick: "eve",
+		Timestamp:  1234,
+		Body:       "pretending to be someone else",
+		Seq:        1,
+	}
+
+	envelope, err := SignMessage(signerPriv, rec)
+	if err != nil {
+		t.Fatalf("SignMessage: %v", err)
+	}
+
+	if _, err := OpenMessage(envelope); err == nil {
+		t.Fatalf("OpenMessage accepted an envelope whose signer doesn't match the declared sender")
+	}
+}
+
+func TestOpenMessageRejectsTamperedEnvelope(t *testing.T) {
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, -1, rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key pair: %v", err)
+	}
+	selfID, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("error deriving peer ID: %v", err)
+	}
+
+	rec := &MessageRecord{SenderID: selfID, SenderNick: "alice", Timestamp: 1234, Body: "hello", Seq: 1}
+	envelope, err := SignMessage(priv, rec)
+	if err != nil {
+		t.Fatalf("SignMessage: %v", err)
+	}
+
+	tampered := append([]byte(nil), envelope...)
+	tampered[len(tampered)-1] ^= 0xFF
+
+	if _, err := OpenMessage(tampered); err == nil {
+		t.Fatalf("OpenMessage accepted a tampered envelope")
+	}
+}
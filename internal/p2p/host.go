@@ -0,0 +1,120 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// LoadOrGenerateIdentity loads the Ed25519 private key stored at path, or
+// generates one and persists it there (mode 0600) if it doesn't exist yet.
+// An empty path generates a fresh, non-persisted key, matching the old
+// behavior of a new peer ID on every run.
+func LoadOrGenerateIdentity(path string) (crypto.PrivKey, error) {
+	if path == "" {
+		priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, -1, rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("error generating identity key pair: %v", err)
+		}
+		return priv, nil
+	}
+
+	if raw, err := os.ReadFile(path); err == nil {
+		priv, err := crypto.UnmarshalPrivateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing identity key at %s: %v", path, err)
+		}
+		return priv, nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading identity key at %s: %v", path, err)
+	}
+
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, -1, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating identity key pair: %v", err)
+	}
+
+	raw, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling identity key: %v", err)
+	}
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		return nil, fmt.Errorf("error writing identity key to %s: %v", path, err)
+	}
+
+	return priv, nil
+}
+
+// LoadSwarmKey reads a well-formed "/key/swarm/psk/1.0.0/" pre-shared key
+// file, as written by GenerateSwarmKey, from path.
+func LoadSwarmKey(path string) (pnet.PSK, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening swarm key file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	psk, err := pnet.DecodeV1PSK(f)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding swarm key file %s: %v", path, err)
+	}
+	return psk, nil
+}
+
+// GenerateSwarmKey writes a fresh 32-byte pre-shared key to path in the
+// well-formed "/key/swarm/psk/1.0.0/" format, for the `gen-swarm-key`
+// subcommand.
+func GenerateSwarmKey(path string) error {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return fmt.Errorf("error generating swarm key: %v", err)
+	}
+
+	contents := fmt.Sprintf("/key/swarm/psk/1.0.0/\n/base16/\n%s\n", hex.EncodeToString(key[:]))
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		return fmt.Errorf("error writing swarm key to %s: %v", path, err)
+	}
+	return nil
+}
+
+// CreateHost creates a libp2p host listening on the given TCP port, using
+// priv as its identity key. An empty port lets the OS pick a free one.
+// When enableRelay is true the host runs Circuit Relay v2 in client mode,
+// so it can still be dialed while behind a NAT it hasn't configured port
+// forwarding for. A non-nil psk turns the swarm into a private network:
+// only peers presenting the same key can complete the handshake.
+func CreateHost(port string, enableRelay bool, priv crypto.PrivKey, psk pnet.PSK) (host.Host, error) {
+	if port == "" {
+		port = "0"
+	}
+
+	listenAddr, err := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/0.0.0.0/tcp/%s", port))
+	if err != nil {
+		return nil, fmt.Errorf("error building listen address: %v", err)
+	}
+
+	opts := []libp2p.Option{
+		libp2p.ListenAddrs(listenAddr),
+		libp2p.Identity(priv),
+	}
+	if enableRelay {
+		opts = append(opts, libp2p.EnableRelay())
+	}
+	if psk != nil {
+		opts = append(opts, libp2p.PrivateNetwork(psk))
+	}
+
+	h, err := libp2p.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating libp2p host: %v", err)
+	}
+
+	return h, nil
+}
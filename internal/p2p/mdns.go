@@ -0,0 +1,30 @@
+package p2p
+
+import (
+	"log"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+)
+
+const mdnsServiceTag = "talklocal-mdns"
+
+type mdnsNotifee struct {
+	peerChan chan peer.AddrInfo
+}
+
+func (n *mdnsNotifee) HandlePeerFound(pi peer.AddrInfo) {
+	n.peerChan <- pi
+}
+
+// InitMDNS starts local network peer discovery scoped to the given
+// rendezvous string and returns a channel of peers as they are found.
+func InitMDNS(h host.Host, rendezvous string) chan peer.AddrInfo {
+	notifee := &mdnsNotifee{peerChan: make(chan peer.AddrInfo, 32)}
+	service := mdns.NewMdnsService(h, mdnsServiceTag+"-"+rendezvous, notifee)
+	if err := service.Start(); err != nil {
+		log.Fatal("Error starting mDNS service:", err)
+	}
+	return notifee.peerChan
+}
@@ -0,0 +1,170 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const peerDiscoveryTopicPrefix = "talklocal-peer-discovery-"
+
+// defaultHeartbeat is used when a non-positive heartbeat is given to
+// NewPubSubPeerDiscovery.
+const defaultHeartbeat = 30 * time.Second
+
+// peerAnnouncement is what each node periodically publishes about itself,
+// signed as a MessageRecord so a listener can trust the addresses actually
+// came from the peer ID they're attributed to.
+type peerAnnouncement struct {
+	Addrs []string
+}
+
+// PubSubPeerDiscovery periodically announces this node's own address info
+// on a dedicated pubsub topic, and connects to any peer it hears announce
+// itself that it isn't already connected to. Once two peers meet through
+// any path (mDNS, DHT, a manual dial), this lets the rest of the mesh
+// converge without every pair needing to discover each other independently.
+type PubSubPeerDiscovery struct {
+	h     host.Host
+	topic *pubsub.Topic
+	sub   *pubsub.Subscription
+
+	selfID peer.ID
+	priv   crypto.PrivKey
+	seq    uint64
+
+	heartbeat time.Duration
+}
+
+// NewPubSubPeerDiscovery joins the peer-discovery topic for rendezvous. priv
+// signs every outgoing announcement and its public key is used to derive the
+// host's peer ID, the same way JoinChatRoom and JoinDiscoveryRoom do. A
+// non-positive heartbeat falls back to a 30 second announce interval.
+func NewPubSubPeerDiscovery(ps *pubsub.PubSub, h host.Host, priv crypto.PrivKey, rendezvous string, heartbeat time.Duration) (*PubSubPeerDiscovery, error) {
+	selfID, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving peer ID from identity key: %v", err)
+	}
+
+	topic, err := ps.Join(peerDiscoveryTopicPrefix + rendezvous)
+	if err != nil {
+		return nil, fmt.Errorf("error joining peer discovery topic: %v", err)
+	}
+
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return nil, fmt.Errorf("error subscribing to peer discovery topic: %v", err)
+	}
+
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+
+	return &PubSubPeerDiscovery{h: h, topic: topic, sub: sub, selfID: selfID, priv: priv, heartbeat: heartbeat}, nil
+}
+
+// Start launches the announce and listen loops. Both loops stop once ctx
+// is done.
+func (d *PubSubPeerDiscovery) Start(ctx context.Context) {
+	go d.announceLoop(ctx)
+	go d.listenLoop(ctx)
+}
+
+func (d *PubSubPeerDiscovery) announceLoop(ctx context.Context) {
+	ticker := time.NewTicker(d.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		d.announce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *PubSubPeerDiscovery) announce(ctx context.Context) {
+	addrs := make([]string, 0, len(d.h.Addrs()))
+	for _, a := range d.h.Addrs() {
+		addrs = append(addrs, a.String())
+	}
+
+	body, err := json.Marshal(peerAnnouncement{Addrs: addrs})
+	if err != nil {
+		log.Printf("pubsub peer discovery: error marshalling announcement: %v", err)
+		return
+	}
+
+	d.seq++
+	rec := &MessageRecord{
+		SenderID:  d.selfID,
+		Timestamp: time.Now().Unix(),
+		Body:      string(body),
+		Seq:       d.seq,
+	}
+
+	envelope, err := SignMessage(d.priv, rec)
+	if err != nil {
+		log.Printf("pubsub peer discovery: error signing announcement: %v", err)
+		return
+	}
+
+	if err := d.topic.Publish(ctx, envelope); err != nil {
+		log.Printf("pubsub peer discovery: error publishing announcement: %v", err)
+	}
+}
+
+func (d *PubSubPeerDiscovery) listenLoop(ctx context.Context) {
+	for {
+		msg, err := d.sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		if msg.ReceivedFrom == d.h.ID() {
+			continue
+		}
+
+		rec, err := OpenMessage(msg.Data)
+		if err != nil {
+			log.Printf("pubsub peer discovery: dropping unverifiable announcement from %s: %v", msg.ReceivedFrom, err)
+			continue
+		}
+
+		var ann peerAnnouncement
+		if err := json.Unmarshal([]byte(rec.Body), &ann); err != nil {
+			continue
+		}
+
+		pid := rec.SenderID
+		if d.h.Network().Connectedness(pid) == network.Connected {
+			continue
+		}
+
+		var addrs []multiaddr.Multiaddr
+		for _, a := range ann.Addrs {
+			ma, err := multiaddr.NewMultiaddr(a)
+			if err != nil {
+				continue
+			}
+			addrs = append(addrs, ma)
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+
+		if err := d.h.Connect(ctx, peer.AddrInfo{ID: pid, Addrs: addrs}); err != nil {
+			log.Printf("pubsub peer discovery: failed to connect to %s: %v", pid, err)
+		}
+	}
+}